@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionTTL is how long a session token remains valid before the server
+// refuses to accept a score submission against it.
+const sessionTTL = 15 * time.Minute
+
+// maxNonces bounds the in-memory nonce cache so a flood of signed
+// /api/score submissions can't grow it unbounded; oldest entries are
+// evicted on insert once the cache is full.
+const maxNonces = 10000
+
+// strictMode, when true, rejects any /api/score submission that does not
+// carry a valid signed session token. It's off by default so existing
+// clients keep working during rollout; set STRICT_SCORE_MODE=1 to enable.
+var strictMode = os.Getenv("STRICT_SCORE_MODE") == "1"
+
+var signingKey ed25519.PrivateKey
+
+// SessionClaims is the payload embedded in a signed session token. It pins
+// the kanji ranges and expected question count chosen at test start so a
+// later score submission can be checked against what was actually issued.
+type SessionClaims struct {
+	Ranges        string    `json:"ranges"`
+	Nonce         string    `json:"nonce"`
+	ExpectedTotal int       `json:"expected_total"`
+	IssuedAt      time.Time `json:"issued_at"`
+}
+
+// SessionToken is the JWT-style compact encoding returned to the client:
+// base64(payload) + "." + base64(signature). Clients treat it as opaque
+// and echo it back unmodified with their score submission.
+type SessionToken string
+
+// LoadKey reads an Ed25519 private key PEM file (PKCS#8, "PRIVATE KEY"
+// block) from path and returns it. The server uses the same key to sign
+// session tokens and to verify their signatures later.
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %v", err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found in signing key file")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS8 signing key: %v", err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is %T, want ed25519.PrivateKey", key)
+	}
+
+	return priv, nil
+}
+
+// initSigningKey loads the Ed25519 key used to sign and verify session
+// tokens from the path in SCORE_SIGNING_KEY_PATH. If unset, a fresh
+// throwaway key is generated so the server still runs in dev/strict=off
+// mode without requiring operators to provision a key up front.
+func initSigningKey() error {
+	path := os.Getenv("SCORE_SIGNING_KEY_PATH")
+	if path == "" {
+		if strictMode {
+			return errors.New("SCORE_SIGNING_KEY_PATH must be set when STRICT_SCORE_MODE=1")
+		}
+		_, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return fmt.Errorf("failed to generate signing key: %v", err)
+		}
+		signingKey = priv
+		log.Println("⚠️ No SCORE_SIGNING_KEY_PATH set, generated an ephemeral signing key")
+		return nil
+	}
+
+	priv, err := LoadKey(path)
+	if err != nil {
+		return err
+	}
+	signingKey = priv
+	return nil
+}
+
+// newSessionToken signs a fresh SessionClaims for the given ranges and
+// expected question count, stamping a random nonce and the current time.
+func newSessionToken(ranges string, expectedTotal int) (SessionToken, error) {
+	nonce, err := randomNonce()
+	if err != nil {
+		return "", err
+	}
+
+	claims := SessionClaims{
+		Ranges:        ranges,
+		Nonce:         nonce,
+		ExpectedTotal: expectedTotal,
+		IssuedAt:      time.Now().UTC(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal session claims: %v", err)
+	}
+
+	sig := ed25519.Sign(signingKey, payload)
+
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return SessionToken(token), nil
+}
+
+// verifySessionToken checks the token's signature and decodes its claims.
+// It does not check nonce reuse or expiry; callers do that separately so
+// the score handler can return distinct error messages.
+func verifySessionToken(token SessionToken) (*SessionClaims, error) {
+	parts := strings.SplitN(string(token), ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed session token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed session token payload")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed session token signature")
+	}
+
+	if !ed25519.Verify(signingKey.Public().(ed25519.PublicKey), payload, sig) {
+		return nil, errors.New("invalid session token signature")
+	}
+
+	var claims SessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed session token claims")
+	}
+	return &claims, nil
+}
+
+// randomNonce returns a URL-safe random identifier used to detect replayed
+// session tokens.
+func randomNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// nonceStore is a bounded, TTL-based cache of nonces that have already been
+// redeemed by a score submission, so a captured request/response pair can't
+// be replayed. It's intentionally in-memory: losing it on restart just
+// means a narrow window where old tokens could be replayed once, which is
+// an acceptable tradeoff against standing up a dedicated table for it.
+type nonceStore struct {
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	maxSize int
+	ttl     time.Duration
+}
+
+var usedNonces = &nonceStore{
+	seen:    make(map[string]time.Time),
+	maxSize: maxNonces,
+	ttl:     sessionTTL,
+}
+
+// claim records nonce as used and reports whether the claim succeeded: it
+// returns false if nonce was already present (and not yet expired), true
+// otherwise. Expired entries are swept opportunistically.
+func (s *nonceStore) claim(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if expiresAt, ok := s.seen[nonce]; ok && now.Before(expiresAt) {
+		return false
+	}
+
+	if len(s.seen) >= s.maxSize {
+		for n, expiresAt := range s.seen {
+			if now.After(expiresAt) {
+				delete(s.seen, n)
+			}
+		}
+	}
+	if len(s.seen) >= s.maxSize {
+		// Still full after sweeping expired entries; evict the oldest entry
+		// (every entry gets the same TTL, so the one closest to expiry)
+		// rather than grow unbounded.
+		var oldest string
+		var oldestExpiry time.Time
+		found := false
+		for n, expiresAt := range s.seen {
+			if !found || expiresAt.Before(oldestExpiry) {
+				oldest, oldestExpiry, found = n, expiresAt, true
+			}
+		}
+		delete(s.seen, oldest)
+	}
+
+	s.seen[nonce] = now.Add(s.ttl)
+	return true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadKeyPKCS8 guards against regressing to treating the PEM block's
+// raw DER bytes as a 64-byte seed+pubkey: a real PKCS8-encoded Ed25519 key
+// (as produced by `openssl genpkey -algorithm ed25519`) must load and
+// verify correctly.
+func TestLoadKeyPKCS8(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS8 key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "signing_key.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, pemBytes, 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	loaded, err := LoadKey(path)
+	if err != nil {
+		t.Fatalf("LoadKey returned error: %v", err)
+	}
+
+	msg := []byte("test message")
+	sig := ed25519.Sign(loaded, msg)
+	if !ed25519.Verify(priv.Public().(ed25519.PublicKey), msg, sig) {
+		t.Error("signature from loaded key did not verify against the original public key")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// scoresCSVHandler streams the scores table as CSV, honoring optional
+// from/to/name/ranges filters. Rows are written as they're scanned so a
+// large export doesn't have to be buffered in memory.
+func scoresCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := `SELECT id, name, score, total, percent, ranges, created_at FROM scores`
+	where, args := buildScoreFilter(r)
+	query += where + " ORDER BY created_at DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error querying scores for CSV export: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="scores.csv"`)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Printf("Error reading columns for CSV export: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ResultsToCSV(w, rows, columns); err != nil {
+		log.Printf("Error streaming scores CSV: %v", err)
+	}
+}
+
+// leaderboardCSVHandler streams the lifetime leaderboard as CSV.
+func leaderboardCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			name,
+			SUM(score) as total_score,
+			COUNT(*) as tests_taken,
+			AVG(percent) as avg_percent
+		FROM scores
+		GROUP BY name
+		ORDER BY total_score DESC, avg_percent DESC
+	`)
+	if err != nil {
+		log.Printf("Error querying leaderboard for CSV export: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="leaderboard.csv"`)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Printf("Error reading columns for CSV export: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ResultsToCSV(w, rows, columns); err != nil {
+		log.Printf("Error streaming leaderboard CSV: %v", err)
+	}
+}
+
+// buildScoreFilter translates the from/to/name/ranges query params into a
+// SQL WHERE clause (possibly empty) and its positional args.
+func buildScoreFilter(r *http.Request) (string, []any) {
+	var clauses []string
+	var args []any
+
+	q := r.URL.Query()
+
+	if from := q.Get("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			args = append(args, t)
+			clauses = append(clauses, fmt.Sprintf("created_at >= %s", placeholder(len(args))))
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			args = append(args, t.Add(24*time.Hour))
+			clauses = append(clauses, fmt.Sprintf("created_at < %s", placeholder(len(args))))
+		}
+	}
+	if name := q.Get("name"); name != "" {
+		args = append(args, name)
+		clauses = append(clauses, fmt.Sprintf("name = %s", placeholder(len(args))))
+	}
+	if ranges := q.Get("ranges"); ranges != "" {
+		args = append(args, ranges)
+		clauses = append(clauses, fmt.Sprintf("ranges = %s", placeholder(len(args))))
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// ResultsToCSV writes header + rows from an open *sql.Rows to w as CSV,
+// scanning one row at a time and formatting each column by its runtime
+// type so floats, ints, times, and strings all come out readable.
+func ResultsToCSV(w http.ResponseWriter, rows *sql.Rows, columns []string) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("failed to scan row: %v", err)
+		}
+
+		for i, v := range values {
+			record[i] = formatCSVValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		cw.Flush()
+	}
+	return rows.Err()
+}
+
+// formatCSVValue renders a single scanned column value as CSV text.
+func formatCSVValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return fmt.Sprintf("%.2f", val)
+	case float32:
+		return fmt.Sprintf("%.2f", val)
+	case int64:
+		return fmt.Sprintf("%d", val)
+	case int:
+		return fmt.Sprintf("%d", val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
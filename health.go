@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// healthStatus is the JSON body returned by both health endpoints.
+type healthStatus struct {
+	Status     string            `json:"status"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// healthLiveHandler reports that the process is up, with no dependency
+// checks. Orchestrators use this to decide whether to restart the
+// container.
+func healthLiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(healthStatus{Status: "ok"})
+}
+
+// healthReadyHandler reports whether the service can actually serve
+// traffic, pinging the database with a short timeout and returning 503 if
+// it's unreachable, instead of the unconditional 200 this used to return.
+func healthReadyHandler(w http.ResponseWriter, r *http.Request) {
+	components := map[string]string{}
+	ready := true
+
+	if db == nil {
+		components["db"] = "not configured"
+		ready = false
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			components["db"] = "unreachable: " + err.Error()
+			ready = false
+		} else {
+			components["db"] = "ok"
+		}
+	}
+
+	status := healthStatus{Status: "ok", Components: components}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		status.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// windowDurations maps the ?window= values to the lookback period used to
+// filter scores.created_at. "all" has no entry and means no time filter.
+var windowDurations = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// metricColumn maps the ?metric= values to the result column that
+// queryLeaderboard orders by.
+var metricColumn = map[string]string{
+	"total": "total_score",
+	"avg":   "avg_percent",
+	"best":  "best_percent",
+}
+
+// leaderboardHandler returns the top-10 leaderboard, optionally scoped to
+// one or more kanji ranges (?range=N5,N4), a time window (?window=day|
+// week|month|all, default all), and ranked by a metric (?metric=total|
+// avg|best, default total). Each entry's rank_delta is its rank movement
+// versus the equivalent preceding window.
+func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	leaderboardQueriesTotal.Inc()
+
+	q := r.URL.Query()
+	ranges := parseRangesParam(q.Get("range"))
+	window := q.Get("window")
+	metric := q.Get("metric")
+	if metric == "" {
+		metric = "total"
+	}
+	if _, ok := metricColumn[metric]; !ok {
+		http.Error(w, "Invalid metric", http.StatusBadRequest)
+		return
+	}
+	if window != "" && window != "all" {
+		if _, ok := windowDurations[window]; !ok {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := queryLeaderboard(ranges, window, metric, false, 10)
+	if err != nil {
+		log.Printf("Error querying leaderboard: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	previous, err := queryLeaderboard(ranges, window, metric, true, 0)
+	if err != nil {
+		log.Printf("Error querying previous-window leaderboard: %v", err)
+	} else {
+		applyRankDeltas(entries, previous)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// rangesLeaderboardHandler returns a top-10 board per kanji range so
+// players studying a specific JLPT level can see where they stand.
+func rangesLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	leaderboardQueriesTotal.Inc()
+
+	q := r.URL.Query()
+	window := q.Get("window")
+	metric := q.Get("metric")
+	if metric == "" {
+		metric = "total"
+	}
+	if _, ok := metricColumn[metric]; !ok {
+		http.Error(w, "Invalid metric", http.StatusBadRequest)
+		return
+	}
+
+	// Iterate the fixed whitelist of range names rather than SELECT DISTINCT
+	// range_name FROM score_ranges: that query's result size follows
+	// whatever submitters have written, and each distinct name costs two
+	// more queries below, so driving it from request input would let a
+	// client turn one rate-limited call into unbounded DB work.
+	names := sortedRangeNames()
+
+	boards := make([]RangeLeaderboard, 0, len(names))
+	for _, name := range names {
+		entries, err := queryLeaderboard([]string{name}, window, metric, false, 10)
+		if err != nil {
+			log.Printf("Error querying leaderboard for range %s: %v", name, err)
+			continue
+		}
+		previous, err := queryLeaderboard([]string{name}, window, metric, true, 0)
+		if err == nil {
+			applyRankDeltas(entries, previous)
+		}
+		boards = append(boards, RangeLeaderboard{Range: name, Entries: entries})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(boards)
+}
+
+// sortedRangeNames returns validRangeNames' keys in sorted order, so
+// rangesLeaderboardHandler iterates a small, deterministic set of boards.
+func sortedRangeNames() []string {
+	names := make([]string, 0, len(validRangeNames))
+	for name := range validRangeNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseRangesParam splits a comma-separated ?range= value into its parts,
+// trimming whitespace and dropping empties.
+func parseRangesParam(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var ranges []string
+	for _, r := range strings.Split(raw, ",") {
+		r = strings.TrimSpace(r)
+		if r != "" {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// queryLeaderboard aggregates scores into a ranked leaderboard. ranges
+// restricts to scores tagged with any of those kanji ranges (via the
+// score_ranges join table); window restricts to a lookback period
+// ("day"/"week"/"month"/"all"/""); previous shifts that window back by its
+// own length, so callers can compare the current board against it. A
+// limit of 0 means no LIMIT clause.
+func queryLeaderboard(ranges []string, window, metric string, previous bool, limit int) ([]LeaderboardEntry, error) {
+	var args []any
+	whereClauses := []string{}
+
+	if len(ranges) > 0 {
+		placeholders := make([]string, len(ranges))
+		for i, rangeName := range ranges {
+			args = append(args, rangeName)
+			placeholders[i] = placeholder(len(args))
+		}
+		// A subquery, not a join, so a score tagged with more than one of
+		// the requested ranges still contributes exactly one row to the
+		// aggregation below instead of one row per matching range.
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"scores.id IN (SELECT score_id FROM score_ranges WHERE range_name IN (%s))",
+			strings.Join(placeholders, ", "),
+		))
+	}
+
+	if window != "" && window != "all" {
+		dur, ok := windowDurations[window]
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q", window)
+		}
+		end := time.Now().UTC()
+		start := end.Add(-dur)
+		if previous {
+			end = start
+			start = start.Add(-dur)
+		}
+		args = append(args, start)
+		whereClauses = append(whereClauses, fmt.Sprintf("scores.created_at >= %s", placeholder(len(args))))
+		args = append(args, end)
+		whereClauses = append(whereClauses, fmt.Sprintf("scores.created_at < %s", placeholder(len(args))))
+	} else if previous {
+		// There's no well-defined "previous" period for a lifetime board,
+		// so rank movement is simply not reported in that case.
+		return nil, nil
+	}
+
+	where := ""
+	if len(whereClauses) > 0 {
+		where = "WHERE " + strings.Join(whereClauses, " AND ")
+	}
+
+	column, ok := metricColumn[metric]
+	if !ok {
+		return nil, fmt.Errorf("invalid metric %q", metric)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			scores.name,
+			SUM(scores.score) as total_score,
+			COUNT(*) as tests_taken,
+			AVG(scores.percent) as avg_percent,
+			MAX(scores.percent) as best_percent
+		FROM scores
+		%s
+		GROUP BY scores.name
+		ORDER BY %s DESC
+	`, where, column)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	var entries []LeaderboardEntry
+	err := observeDBQuery("leaderboard_windowed", func() error {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		rank := 1
+		for rows.Next() {
+			var entry LeaderboardEntry
+			if err := rows.Scan(&entry.Name, &entry.TotalScore, &entry.TestsTaken, &entry.AvgPercent, &entry.BestPercent); err != nil {
+				return fmt.Errorf("failed to scan row: %v", err)
+			}
+			entry.Rank = rank
+			entries = append(entries, entry)
+			rank++
+		}
+		return rows.Err()
+	})
+	return entries, err
+}
+
+// applyRankDeltas sets each entry's RankDelta to its rank in the previous
+// window minus its rank in entries (positive means the player moved up).
+// Players absent from the previous board are left at zero.
+func applyRankDeltas(entries, previous []LeaderboardEntry) {
+	prevRank := make(map[string]int, len(previous))
+	for _, p := range previous {
+		prevRank[p.Name] = p.Rank
+	}
+	for i := range entries {
+		if pr, ok := prevRank[entries[i].Name]; ok {
+			entries[i].RankDelta = pr - entries[i].Rank
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
@@ -12,13 +14,14 @@ import (
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed kanji_app.html sprites
 var content embed.FS
 
 var db *sql.DB
+var store Store
 
 type Score struct {
 	ID        int       `json:"id"`
@@ -31,61 +34,198 @@ type Score struct {
 }
 
 type LeaderboardEntry struct {
-	Rank       int     `json:"rank"`
-	Name       string  `json:"name"`
-	TotalScore int     `json:"total_score"`
-	TestsTaken int     `json:"tests_taken"`
-	AvgPercent float64 `json:"avg_percent"`
+	Rank        int     `json:"rank"`
+	RankDelta   int     `json:"rank_delta"`
+	Name        string  `json:"name"`
+	TotalScore  int     `json:"total_score"`
+	TestsTaken  int     `json:"tests_taken"`
+	AvgPercent  float64 `json:"avg_percent"`
+	BestPercent float64 `json:"best_percent"`
+}
+
+// RangeLeaderboard is the top-10 board for a single kanji range, returned
+// as part of the /api/leaderboard/ranges response.
+type RangeLeaderboard struct {
+	Range   string             `json:"range"`
+	Entries []LeaderboardEntry `json:"entries"`
 }
 
 type SubmitScoreRequest struct {
-	Name   string `json:"name"`
-	Score  int    `json:"score"`
-	Total  int    `json:"total"`
-	Ranges string `json:"ranges"`
+	Name         string `json:"name"`
+	Score        int    `json:"score"`
+	Total        int    `json:"total"`
+	Ranges       string `json:"ranges"`
+	SessionToken string `json:"session_token,omitempty"`
+}
+
+type SessionRequest struct {
+	Ranges        string `json:"ranges"`
+	ExpectedTotal int    `json:"expected_total"`
 }
 
-func initDB() error {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		// Local development fallback
-		dbURL = "postgres://localhost/kanji_test?sslmode=disable"
+type SessionResponse struct {
+	SessionToken string `json:"session_token"`
+}
+
+// maxElapsedPerQuestion bounds how fast a submitted score can plausibly have
+// been earned: fewer than this many milliseconds per question since the
+// session token was issued is treated as infeasible.
+const maxElapsedPerQuestion = 300 * time.Millisecond
+
+// maxSubmissionAge is how long after a session token was issued a score
+// submission against it is still accepted.
+const maxSubmissionAge = sessionTTL
+
+// initDB picks a Store backend (postgres or sqlite) from the --sql flag or
+// SQL_DRIVER env var, opens it, runs its migrations, and backfills
+// score_ranges for rows that predate that table.
+func initDB(driver string) error {
+	dataSource := os.Getenv("DATABASE_URL")
+	if dataSource == "" {
+		switch driver {
+		case "sqlite":
+			dataSource = "kanji_test.db"
+		default:
+			// Local development fallback
+			dataSource = "postgres://localhost/kanji_test?sslmode=disable"
+		}
 	}
 
-	var err error
-	db, err = sql.Open("postgres", dbURL)
+	s, err := newStore(driver, dataSource)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
-	}
-
-	// Test connection
-	if err = db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
-	}
-
-	// Create tables
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS scores (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(50) NOT NULL,
-			score INTEGER NOT NULL,
-			total INTEGER NOT NULL,
-			percent DECIMAL(5,2) NOT NULL,
-			ranges VARCHAR(255),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_scores_name ON scores(name);
-		CREATE INDEX IF NOT EXISTS idx_scores_percent ON scores(percent DESC);
+		return err
+	}
+
+	if err := s.Migrate(); err != nil {
+		return fmt.Errorf("failed to run migrations: %v", err)
+	}
+
+	store = s
+	db = s.DB()
+	sqlDriver = driver
+
+	if err := migrateScoreRanges(); err != nil {
+		return fmt.Errorf("failed to backfill score_ranges: %v", err)
+	}
+
+	log.Println("✅ Database initialized")
+	return nil
+}
+
+// migrateScoreRanges backfills the score_ranges join table for scores rows
+// that predate it, parsing the ranges CSV column in Go so the backfill
+// works the same way against either SQL driver.
+func migrateScoreRanges() error {
+	rows, err := db.Query(`
+		SELECT s.id, s.ranges FROM scores s
+		WHERE s.ranges IS NOT NULL AND s.ranges <> ''
+		  AND NOT EXISTS (SELECT 1 FROM score_ranges sr WHERE sr.score_id = s.id)
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to create tables: %v", err)
+		return err
 	}
 
-	log.Println("✅ Database initialized")
+	type pendingScore struct {
+		id     int
+		ranges string
+	}
+	var pending []pendingScore
+	for rows.Next() {
+		var p pendingScore
+		if err := rows.Scan(&p.id, &p.ranges); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		if err := store.InsertScoreRanges(p.id, p.ranges); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// sessionHandler issues a short-lived, server-signed session token for a
+// test about to start. The client must echo this token back unmodified
+// when it submits the score, so the server can check the result against
+// what was actually handed out.
+func sessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpectedTotal <= 0 {
+		http.Error(w, "Invalid expected_total", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newSessionToken(req.Ranges, req.ExpectedTotal)
+	if err != nil {
+		log.Printf("Error creating session token: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionResponse{SessionToken: string(token)})
+}
+
+// verifySubmission checks req's session token against the signature,
+// nonce-reuse, elapsed-time, expected-count, and ranges rules. claims is nil (with
+// no error) when strict mode is off and the request carries no token.
+func verifySubmission(req SubmitScoreRequest) (*SessionClaims, error) {
+	if req.SessionToken == "" {
+		if strictMode {
+			return nil, errors.New("session_token required")
+		}
+		return nil, nil
+	}
+
+	claims, err := verifySessionToken(SessionToken(req.SessionToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if !usedNonces.claim(claims.Nonce) {
+		return nil, errors.New("session token already used")
+	}
+
+	elapsed := time.Since(claims.IssuedAt)
+	if elapsed > maxSubmissionAge {
+		return nil, errors.New("session token expired")
+	}
+
+	if req.Total != claims.ExpectedTotal {
+		return nil, errors.New("total does not match session token")
+	}
+
+	if req.Ranges != claims.Ranges {
+		return nil, errors.New("ranges do not match session token")
+	}
+
+	if req.Score > req.Total {
+		return nil, errors.New("score exceeds total")
+	}
+	if elapsed < time.Duration(req.Total)*maxElapsedPerQuestion {
+		return nil, errors.New("score not plausible in elapsed time")
+	}
+
+	return claims, nil
+}
+
 func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -98,6 +238,11 @@ func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := verifySubmission(req); err != nil {
+		http.Error(w, fmt.Sprintf("Rejected submission: %v", err), http.StatusForbidden)
+		return
+	}
+
 	// Sanitize name
 	name := strings.TrimSpace(req.Name)
 	if len(name) == 0 || len(name) > 50 {
@@ -105,6 +250,13 @@ func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, rangeName := range parseRangeNames(req.Ranges) {
+		if !validRangeNames[rangeName] {
+			http.Error(w, fmt.Sprintf("Invalid range %q", rangeName), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Calculate percent
 	percent := 0.0
 	if req.Total > 0 {
@@ -112,60 +264,21 @@ func submitScoreHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert score
-	_, err := db.Exec(
-		"INSERT INTO scores (name, score, total, percent, ranges) VALUES ($1, $2, $3, $4, $5)",
-		name, req.Score, req.Total, percent, req.Ranges,
-	)
+	scoreID, err := store.SubmitScore(name, req.Score, req.Total, percent, req.Ranges)
 	if err != nil {
 		log.Printf("Error inserting score: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-}
-
-func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Get aggregated leaderboard (top 10 by total score)
-	rows, err := db.Query(`
-		SELECT 
-			name,
-			SUM(score) as total_score,
-			COUNT(*) as tests_taken,
-			AVG(percent) as avg_percent
-		FROM scores
-		GROUP BY name
-		ORDER BY total_score DESC, avg_percent DESC
-		LIMIT 10
-	`)
-	if err != nil {
-		log.Printf("Error querying leaderboard: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
+	if err := store.InsertScoreRanges(scoreID, req.Ranges); err != nil {
+		log.Printf("Error inserting score ranges: %v", err)
 	}
-	defer rows.Close()
 
-	var leaderboard []LeaderboardEntry
-	rank := 1
-	for rows.Next() {
-		var entry LeaderboardEntry
-		if err := rows.Scan(&entry.Name, &entry.TotalScore, &entry.TestsTaken, &entry.AvgPercent); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
-		}
-		entry.Rank = rank
-		leaderboard = append(leaderboard, entry)
-		rank++
-	}
+	scoreSubmissionsTotal.Inc()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leaderboard)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 func recentScoresHandler(w http.ResponseWriter, r *http.Request) {
@@ -174,29 +287,12 @@ func recentScoresHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get recent scores
-	rows, err := db.Query(`
-		SELECT name, score, total, percent, ranges, created_at
-		FROM scores
-		ORDER BY created_at DESC
-		LIMIT 5
-	`)
+	scores, err := store.RecentScores(5)
 	if err != nil {
 		log.Printf("Error querying recent scores: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var scores []Score
-	for rows.Next() {
-		var s Score
-		if err := rows.Scan(&s.Name, &s.Score, &s.Total, &s.Percent, &s.Ranges, &s.CreatedAt); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
-		}
-		scores = append(scores, s)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(scores)
@@ -208,18 +304,36 @@ func main() {
 		port = "8080"
 	}
 
+	driver := flag.String("sql", os.Getenv("SQL_DRIVER"), "SQL driver to use: postgres or sqlite (env SQL_DRIVER)")
+	flag.Parse()
+	if *driver == "" {
+		*driver = "postgres"
+	}
+
 	// Initialize database
-	if err := initDB(); err != nil {
+	if err := initDB(*driver); err != nil {
 		log.Printf("⚠️ Database not available: %v", err)
 		log.Println("Running without leaderboard functionality")
 	}
 
+	if err := initSigningKey(); err != nil {
+		log.Fatalf("Failed to initialize signing key: %v", err)
+	}
+
 	mux := http.NewServeMux()
 
-	// API endpoints
-	mux.HandleFunc("/api/score", submitScoreHandler)
-	mux.HandleFunc("/api/leaderboard", leaderboardHandler)
-	mux.HandleFunc("/api/recent", recentScoresHandler)
+	// API endpoints. Every handler gets recovery + logging; the
+	// leaderboard reads and score submission additionally get per-IP
+	// rate limiting and gzip compression. The CSV exports stream their
+	// response row-by-row, so they skip GzipJSON, which would otherwise
+	// have to buffer the whole export in memory.
+	mux.Handle("/api/session", Chain(http.HandlerFunc(sessionHandler), Recover, RequestLogger, Metrics))
+	mux.Handle("/api/score", Chain(http.HandlerFunc(submitScoreHandler), Recover, RequestLogger, Metrics, RateLimit(scoreLimiter), GzipJSON))
+	mux.Handle("/api/leaderboard", Chain(http.HandlerFunc(leaderboardHandler), Recover, RequestLogger, Metrics, RateLimit(leaderboardLimiter), GzipJSON))
+	mux.Handle("/api/recent", Chain(http.HandlerFunc(recentScoresHandler), Recover, RequestLogger, Metrics, GzipJSON))
+	mux.Handle("/api/scores.csv", Chain(http.HandlerFunc(scoresCSVHandler), Recover, RequestLogger, Metrics))
+	mux.Handle("/api/leaderboard.csv", Chain(http.HandlerFunc(leaderboardCSVHandler), Recover, RequestLogger, Metrics))
+	mux.Handle("/api/leaderboard/ranges", Chain(http.HandlerFunc(rangesLeaderboardHandler), Recover, RequestLogger, Metrics, RateLimit(leaderboardLimiter), GzipJSON))
 
 	// Main page
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -245,11 +359,13 @@ func main() {
 	}
 	mux.Handle("/sprites/", http.StripPrefix("/sprites/", http.FileServer(http.FS(spritesFS))))
 
-	// Health check
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	// Health checks: /health/live is the process being up, /health/ready
+	// also verifies the database is reachable.
+	mux.HandleFunc("/health/live", healthLiveHandler)
+	mux.HandleFunc("/health/ready", healthReadyHandler)
+
+	// Prometheus metrics
+	mux.Handle("/metrics", promhttp.Handler())
 
 	fmt.Printf("🎌 Kanji Test Server running on http://localhost:%s\n", port)
 	log.Fatal(http.ListenAndServe(":"+port, mux))
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSubmitScoreHandlerRejectsInvalidRange guards against ranges in
+// score_ranges drifting from the known JLPT levels in validRangeNames: a
+// submission tagged with any other range name must be rejected with 400
+// and not persisted.
+func TestSubmitScoreHandlerRejectsInvalidRange(t *testing.T) {
+	setupTestStore(t)
+
+	body, _ := json.Marshal(SubmitScoreRequest{Name: "alice", Score: 1, Total: 1, Ranges: "N5,garbage"})
+	req := httptest.NewRequest(http.MethodPost, "/api/score", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	submitScoreHandler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid range, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	scores, err := store.RecentScores(10)
+	if err != nil {
+		t.Fatalf("failed to query recent scores: %v", err)
+	}
+	if len(scores) != 0 {
+		t.Errorf("expected rejected submission not to be persisted, found %d scores", len(scores))
+	}
+}
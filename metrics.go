@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// version and commit identify the running build. Set at build time via:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+var (
+	scoreSubmissionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kanji_score_submissions_total",
+		Help: "Total number of score submissions accepted.",
+	})
+
+	leaderboardQueriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kanji_leaderboard_queries_total",
+		Help: "Total number of leaderboard queries served.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kanji_db_query_duration_seconds",
+		Help:    "Duration of database queries, by query name.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kanji_http_requests_total",
+		Help: "Total HTTP requests, by method, path, and status code.",
+	}, []string{"method", "path", "status"})
+
+	buildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kanji_build_info",
+		Help: "Build metadata; the series value is always 1.",
+	}, []string{"version", "commit"})
+)
+
+func init() {
+	buildInfo.WithLabelValues(version, commit).Set(1)
+}
+
+// observeDBQuery runs fn and records its duration under dbQueryDuration,
+// labeled with query so slow queries are easy to pick out in Prometheus.
+func observeDBQuery(query string, fn func() error) error {
+	timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues(query))
+	defer timer.ObserveDuration()
+	return fn()
+}
+
+// Metrics records each request's method, path, and status code in
+// httpRequestsTotal.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(rec.status)).Inc()
+	})
+}
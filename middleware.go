@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Middleware wraps an http.Handler with cross-cutting behavior (logging,
+// recovery, rate limiting, compression, ...). Chain composes several of
+// them in order, so new handlers pick up the same behavior just by being
+// registered through it.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with mws in the order given, so mws[0] is the outermost
+// handler (the first to see the request, the last to see the response).
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// scoreLimiter and leaderboardLimiter are the per-IP token buckets for
+// /api/score (10/minute) and the leaderboard read endpoints (60/minute).
+var scoreLimiter = newIPRateLimiter(10.0/60, 10)
+var leaderboardLimiter = newIPRateLimiter(60.0/60, 60)
+
+// ipRateLimiter hands out a golang.org/x/time/rate.Limiter per client IP,
+// so one abusive caller can't exhaust another's budget.
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	rate     rate.Limit
+	burst    int
+}
+
+func newIPRateLimiter(perSecond float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limiters: make(map[string]*rate.Limiter),
+		rate:     rate.Limit(perSecond),
+		burst:    burst,
+	}
+}
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	limiter, ok := l.limiters[ip]
+	if !ok {
+		limiter = rate.NewLimiter(l.rate, l.burst)
+		l.limiters[ip] = limiter
+	}
+	l.mu.Unlock()
+	return limiter.Allow()
+}
+
+// RateLimit rejects requests beyond limiter's per-IP budget with 429.
+func RateLimit(limiter *ipRateLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.allow(clientIP(r)) {
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP extracts the caller's address, stripping the port from
+// RemoteAddr. It does not trust X-Forwarded-For, since this server isn't
+// expected to sit behind a proxy that sets it reliably.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder captures the status code written by the wrapped handler
+// so RequestLogger can log it after the fact.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// RequestLogger logs method, path, status, and duration for every request.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start))
+	})
+}
+
+// Recover turns a panic in the wrapped handler into a JSON 500 instead of
+// crashing the server or leaking a bare stack trace to the client.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("panic handling %s %s: %v", r.Method, r.URL.Path, err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gzipMinSize is the response size above which GzipJSON bothers compressing.
+const gzipMinSize = 1024
+
+// gzipBufferingWriter buffers the response so GzipJSON can decide, once the
+// handler is done, whether it's worth gzipping.
+type gzipBufferingWriter struct {
+	http.ResponseWriter
+	buf        bytes.Buffer
+	statusCode int
+}
+
+func (g *gzipBufferingWriter) WriteHeader(code int) {
+	g.statusCode = code
+}
+
+func (g *gzipBufferingWriter) Write(b []byte) (int, error) {
+	return g.buf.Write(b)
+}
+
+// GzipJSON gzip-compresses JSON responses over gzipMinSize bytes when the
+// client advertises gzip support, leaving smaller responses and other
+// content types untouched. It's only applied to handlers whose entire
+// response is small enough to buffer in memory; streaming handlers (e.g.
+// CSV export) intentionally skip this middleware.
+func GzipJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &gzipBufferingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		body := buf.buf.Bytes()
+		contentType := w.Header().Get("Content-Type")
+		acceptsGzip := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+
+		if acceptsGzip && strings.HasPrefix(contentType, "application/json") && len(body) > gzipMinSize {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(buf.statusCode)
+			gz := gzip.NewWriter(w)
+			gz.Write(body)
+			gz.Close()
+			return
+		}
+
+		w.WriteHeader(buf.statusCode)
+		w.Write(body)
+	})
+}
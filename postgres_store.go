@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresStore is the production Store backend.
+type postgresStore struct {
+	db *sql.DB
+}
+
+func newPostgresStore(dataSource string) (Store, error) {
+	db, err := sql.Open("postgres", dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+	return &postgresStore{db: db}, nil
+}
+
+func (s *postgresStore) Migrate() error {
+	return runMigrations(s.db, "postgres")
+}
+
+func (s *postgresStore) DB() *sql.DB {
+	return s.db
+}
+
+func (s *postgresStore) SubmitScore(name string, score, total int, percent float64, ranges string) (int, error) {
+	var id int
+	err := observeDBQuery("submit_score", func() error {
+		return s.db.QueryRow(
+			"INSERT INTO scores (name, score, total, percent, ranges) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			name, score, total, percent, ranges,
+		).Scan(&id)
+	})
+	return id, err
+}
+
+func (s *postgresStore) InsertScoreRanges(scoreID int, ranges string) error {
+	for _, name := range parseRangeNames(ranges) {
+		if _, err := s.db.Exec(
+			"INSERT INTO score_ranges (score_id, range_name) VALUES ($1, $2)",
+			scoreID, name,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) RecentScores(limit int) ([]Score, error) {
+	var scores []Score
+	err := observeDBQuery("recent_scores", func() error {
+		rows, err := s.db.Query(`
+			SELECT name, score, total, percent, ranges, created_at
+			FROM scores
+			ORDER BY created_at DESC
+			LIMIT $1
+		`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		scores, err = scanScores(rows)
+		return err
+	})
+	return scores, err
+}
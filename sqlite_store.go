@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore is the Store backend for local dev, CI, and small
+// self-hosted deployments that don't want to stand up Postgres. SQLite
+// doesn't support concurrent writers, so writes are serialized with mu.
+type sqliteStore struct {
+	db *sql.DB
+	mu sync.Mutex
+}
+
+func newSQLiteStore(dataSource string) (Store, error) {
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping sqlite database: %v", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Migrate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return runMigrations(s.db, "sqlite")
+}
+
+func (s *sqliteStore) DB() *sql.DB {
+	return s.db
+}
+
+func (s *sqliteStore) SubmitScore(name string, score, total int, percent float64, ranges string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id int64
+	err := observeDBQuery("submit_score", func() error {
+		result, err := s.db.Exec(
+			"INSERT INTO scores (name, score, total, percent, ranges) VALUES (?, ?, ?, ?, ?)",
+			name, score, total, percent, ranges,
+		)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	return int(id), err
+}
+
+func (s *sqliteStore) InsertScoreRanges(scoreID int, ranges string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range parseRangeNames(ranges) {
+		if _, err := s.db.Exec(
+			"INSERT INTO score_ranges (score_id, range_name) VALUES (?, ?)",
+			scoreID, name,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) RecentScores(limit int) ([]Score, error) {
+	var scores []Score
+	err := observeDBQuery("recent_scores", func() error {
+		rows, err := s.db.Query(`
+			SELECT name, score, total, percent, ranges, created_at
+			FROM scores
+			ORDER BY created_at DESC
+			LIMIT ?
+		`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		scores, err = scanScores(rows)
+		return err
+	})
+	return scores, err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Store abstracts score persistence so the server can run against Postgres
+// in production or SQLite for local dev, CI, and small self-hosted
+// deployments without touching handler code. Handlers that need ad-hoc SQL
+// beyond these operations (CSV export, per-range/windowed leaderboards) go
+// through DB() and stay driver-aware via placeholder().
+type Store interface {
+	SubmitScore(name string, score, total int, percent float64, ranges string) (int, error)
+	InsertScoreRanges(scoreID int, ranges string) error
+	RecentScores(limit int) ([]Score, error)
+	Migrate() error
+	DB() *sql.DB
+}
+
+// sqlDriver is the driver name of the currently active Store ("postgres" or
+// "sqlite"). It's used by placeholder() so raw-SQL handlers that bypass the
+// Store interface still build queries the active driver understands.
+var sqlDriver string
+
+// placeholder returns the positional parameter marker for the nth
+// (1-indexed) argument in a query, in the active driver's dialect.
+func placeholder(n int) string {
+	if sqlDriver == "sqlite" {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// runMigrations execs every embedded *.sql file under migrations/<driver>,
+// in filename order, against db. Filenames are numbered (0001_, 0002_, ...)
+// so the schema evolves as a versioned, ordered sequence.
+func runMigrations(db *sql.DB, driver string) error {
+	entries, err := migrationsFS.ReadDir("migrations/" + driver)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations for %s: %v", driver, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sqlBytes, err := migrationsFS.ReadFile("migrations/" + driver + "/" + name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %v", name, err)
+		}
+		if _, err := db.Exec(string(sqlBytes)); err != nil {
+			return fmt.Errorf("failed to run migration %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// validRangeNames is the set of kanji ranges a score submission may be
+// tagged with. rangesLeaderboardHandler fans out one pair of queries per
+// name in this whitelist, so its fan-out stays bounded to the handful of
+// real JLPT levels, and submitScoreHandler rejects any other name so
+// score_ranges holds only these.
+var validRangeNames = map[string]bool{
+	"N5": true,
+	"N4": true,
+	"N3": true,
+	"N2": true,
+	"N1": true,
+}
+
+// parseRangeNames splits a comma-separated ranges string (e.g. "N5,N4")
+// into its distinct, trimmed, non-empty parts, so a repeated or blank
+// entry can't inflate a score's row count in score_ranges.
+func parseRangeNames(ranges string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range strings.Split(ranges, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// scanScores reads the common name/score/total/percent/ranges/created_at
+// columns shared by both drivers' RecentScores queries.
+func scanScores(rows *sql.Rows) ([]Score, error) {
+	var scores []Score
+	for rows.Next() {
+		var s Score
+		if err := rows.Scan(&s.Name, &s.Score, &s.Total, &s.Percent, &s.Ranges, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		scores = append(scores, s)
+	}
+	return scores, rows.Err()
+}
+
+// newStore opens a database with the given driver ("postgres" or "sqlite")
+// and dataSource, and returns the matching Store implementation.
+func newStore(driver, dataSource string) (Store, error) {
+	switch driver {
+	case "postgres":
+		return newPostgresStore(dataSource)
+	case "sqlite":
+		return newSQLiteStore(dataSource)
+	default:
+		return nil, fmt.Errorf("unknown SQL driver %q (want postgres or sqlite)", driver)
+	}
+}